@@ -0,0 +1,71 @@
+package hdfs
+
+import (
+	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
+	"github.com/colinmarc/hdfs/rpc"
+	"io"
+)
+
+// SetChecksumPolicy controls whether this Client's Files verify the
+// per-chunk CRC32C checksums that DataNodes send inline with block data. It
+// applies to every block reader opened after the call, including those of
+// Files that are already open. The default is rpc.ChecksumVerify; latency-sensitive callers that
+// trust the network and disks can pass rpc.ChecksumSkip to avoid the CPU
+// cost of verification.
+func (c *Client) SetChecksumPolicy(policy rpc.ChecksumPolicy) {
+	c.checksumPolicy = policy
+}
+
+// Verify reads the entire file from the beginning, verifying every chunk's
+// checksum along the way, without copying any data to the caller. It fails
+// on the first checksum mismatch that survives failover to every replica of
+// a block, and returns nil if the whole file was read successfully.
+func (f *File) Verify() error {
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		_, err := f.Read(buf)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// reportBadBlock tells the NameNode that dataNode served corrupt data for
+// block, so it can be scheduled for re-replication. It's used under
+// rpc.ChecksumVerifyAndRepair after a checksum failure has already caused a
+// failover to another replica; errors are not fatal to the read that
+// triggered it, so they're swallowed here.
+func (c *Client) reportBadBlock(block *hdfs.LocatedBlockProto, dataNode string) {
+	if block == nil {
+		return
+	}
+
+	var locs []*hdfs.DatanodeInfoProto
+	for _, loc := range block.GetLocs() {
+		if loc.GetId().GetHostName() == dataNode {
+			locs = append(locs, loc)
+		}
+	}
+
+	if len(locs) == 0 {
+		return
+	}
+
+	req := &hdfs.ReportBadBlocksRequestProto{
+		Blocks: []*hdfs.LocatedBlockProto{
+			{
+				B:    block.GetB(),
+				Locs: locs,
+			},
+		},
+	}
+	resp := &hdfs.ReportBadBlocksResponseProto{}
+
+	c.namenode.Execute("reportBadBlocks", req, resp)
+}
@@ -1,7 +1,6 @@
 package hdfs
 
 import (
-	"code.google.com/p/goprotobuf/proto"
 	"errors"
 	"fmt"
 	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
@@ -9,24 +8,40 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 )
 
 const clientName = "go-hdfs"
 
 // A File represents an existing file or directory in HDFS. It implements
-// Reader, Seeker, and Closer, and can only be used for reads (and other
-// minor operations like Chmod).
+// Reader, ReaderAt, Seeker, Writer, and Closer, and can be opened either for
+// reading (the default) or for writing, via Client.Open, Client.Create, and
+// Client.OpenFile.
 type File struct {
 	client *Client
 	name   string
 	info   os.FileInfo
 
+	blocksMu           sync.Mutex
 	blocks             []*hdfs.LocatedBlockProto
 	currentBlockReader *rpc.BlockReader
 	offset             int64
 
+	readaheadBytes int
+	ra             *readahead
+
+	excludedLocs       map[string]bool
+	excludedBlock      *hdfs.LocatedBlockProto
+	pendingChecksumErr *rpc.ChecksumError
+
 	readdirLast string
 
+	flag int
+
+	currentBlockWriter *rpc.BlockWriter
+	lastBlock          *hdfs.LocatedBlockProto
+	writeErr           error
+
 	closed       bool
 	allowWriting bool
 }
@@ -59,6 +74,10 @@ func (f *File) Name() string {
 //
 // The seek is virtual - it starts a new read operation at the new position.
 func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.allowWriting {
+		return f.offset, errors.New("Seek is not supported on files opened for writing.")
+	}
+
 	var off int64
 	if whence == 0 {
 		off = offset
@@ -74,68 +93,13 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 		return f.offset, fmt.Errorf("Invalid resulting offset: %d", off)
 	}
 
+	f.stopReadahead()
 	f.offset = off
 	f.currentBlockReader = nil
 
 	return f.offset, nil
 }
 
-// Read reads up to len(b) bytes from the File. It returns the number of bytes
-// read and an error, if any. EOF is signaled by a zero count with err set to
-// io.EOF.
-func (f *File) Read(b []byte) (int, error) {
-	if f.offset >= f.info.Size() {
-		return 0, io.EOF
-	}
-
-	if f.blocks == nil {
-		err := f.getBlocks()
-		if err != nil {
-			return 0, err
-		}
-	}
-
-	if f.currentBlockReader == nil {
-		err := f.getNewBlockReader()
-		if err != nil {
-			return 0, err
-		}
-	}
-
-	for {
-		n, err := f.currentBlockReader.Read(b)
-		f.offset += int64(n)
-
-		if err != nil && err != io.EOF {
-			f.currentBlockReader.Close()
-			f.currentBlockReader = nil
-			return n, err
-		} else if n > 0 {
-			return n, nil
-		} else {
-			f.currentBlockReader.Close()
-			f.getNewBlockReader()
-		}
-	}
-}
-
-// ReadAt reads len(b) bytes from the File starting at byte offset off. It
-// returns the number of bytes read and the error, if any. ReadAt always returns
-// a non-nil error when n < len(b). At end of file, that error is io.EOF.
-func (f *File) ReadAt(b []byte, off int64) (int, error) {
-	_, err := f.Seek(off, 0)
-	if err != nil {
-		return 0, err
-	}
-
-	return f.Read(b)
-}
-
-// Close closes the File.
-func (f *File) Close() error {
-	return nil
-}
-
 // Chmod changes the mode of the file to mode.
 func (f *File) Chmod(mode os.FileMode) error {
 	return nil
@@ -211,39 +175,19 @@ func (f *File) Readdirnames(n int) ([]string, error) {
 	return names, nil
 }
 
-func (f *File) getBlocks() error {
-	req := &hdfs.GetBlockLocationsRequestProto{
-		Src:    proto.String(f.name),
-		Offset: proto.Uint64(0),
-		Length: proto.Uint64(uint64(f.info.Size())),
+// Close closes the File, flushing and finalizing any pending writes against
+// the NameNode. For files opened for reading, Close only stops any readahead
+// prefetch.
+func (f *File) Close() error {
+	if f.closed {
+		return nil
 	}
-	resp := &hdfs.GetBlockLocationsResponseProto{}
 
-	err := f.client.namenode.Execute("getBlockLocations", req, resp)
-	if err != nil {
-		return err
+	if f.allowWriting {
+		return f.closeForWriting()
 	}
 
-	f.blocks = resp.GetLocations().GetBlocks()
+	f.stopReadahead()
+	f.closed = true
 	return nil
 }
-
-func (f *File) getNewBlockReader() error {
-	off := uint64(f.offset)
-	for _, block := range f.blocks {
-		start := block.GetOffset()
-		end := start + block.GetB().GetNumBytes()
-
-		if start <= off && off < end {
-			br, err := rpc.NewBlockReader(block, off-start)
-			if err != nil {
-				return err
-			}
-
-			f.currentBlockReader = br
-			return nil
-		}
-	}
-
-	return fmt.Errorf("Couldn't find block for offset: %d", off)
-}
\ No newline at end of file
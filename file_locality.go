@@ -0,0 +1,120 @@
+package hdfs
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
+)
+
+// Tell returns the current offset of the file, without performing a read or
+// altering any internal state. Unlike Seek(0, 1), Tell never touches the
+// NameNode or the current block reader.
+func (f *File) Tell() int64 {
+	return f.offset
+}
+
+// BlockLocation describes where a single block of a file is stored, for use
+// in scheduling compute close to the data.
+type BlockLocation struct {
+	// Hosts is the list of DataNode hostnames holding a replica of the block.
+	Hosts []string
+
+	// Racks is the list of the same DataNodes' rack topology paths, in the
+	// same order as Hosts.
+	Racks []string
+
+	// Offset is the block's starting offset within the file.
+	Offset int64
+
+	// Length is the number of bytes covered by the block.
+	Length int64
+}
+
+// BlockLocations returns the DataNode locations of the blocks that make up
+// the byte range [off, off+length) of f, for use in scheduling compute
+// close to the data (the reason HDFS exposes block placement in the first
+// place). It's satisfied from the cached block list fetched by Read and
+// ReadAt where possible, falling back to a getBlockLocations RPC for any
+// part of the range that isn't covered yet.
+func (f *File) BlockLocations(off, length int64) ([]BlockLocation, error) {
+	blocks, err := f.getBlocksLocked(off, length)
+	if err != nil {
+		return nil, err
+	}
+
+	if !blocksCoverRange(blocks, off, length) {
+		blocks, err = f.fetchBlockLocations(off, length)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	end := off + length
+	var locs []BlockLocation
+	for _, block := range blocks {
+		start := int64(block.GetOffset())
+		blockEnd := start + int64(block.GetB().GetNumBytes())
+
+		if blockEnd <= off || start >= end {
+			continue
+		}
+
+		locs = append(locs, BlockLocation{
+			Hosts:  datanodeHosts(block),
+			Racks:  datanodeRacks(block),
+			Offset: start,
+			Length: blockEnd - start,
+		})
+	}
+
+	return locs, nil
+}
+
+func blocksCoverRange(blocks []*hdfs.LocatedBlockProto, off, length int64) bool {
+	end := off + length
+	for cur := off; cur < end; {
+		block := blockContaining(blocks, uint64(cur))
+		if block == nil {
+			return false
+		}
+
+		cur = int64(block.GetOffset() + block.GetB().GetNumBytes())
+	}
+
+	return true
+}
+
+func (f *File) fetchBlockLocations(off, length int64) ([]*hdfs.LocatedBlockProto, error) {
+	req := &hdfs.GetBlockLocationsRequestProto{
+		Src:    proto.String(f.name),
+		Offset: proto.Uint64(uint64(off)),
+		Length: proto.Uint64(uint64(length)),
+	}
+	resp := &hdfs.GetBlockLocationsResponseProto{}
+
+	err := f.client.namenode.Execute("getBlockLocations", req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.GetLocations().GetBlocks(), nil
+}
+
+func datanodeHosts(block *hdfs.LocatedBlockProto) []string {
+	locs := block.GetLocs()
+	hosts := make([]string, len(locs))
+	for i, loc := range locs {
+		hosts[i] = loc.GetId().GetHostName()
+	}
+
+	return hosts
+}
+
+func datanodeRacks(block *hdfs.LocatedBlockProto) []string {
+	locs := block.GetLocs()
+	racks := make([]string, len(locs))
+	for i, loc := range locs {
+		racks[i] = loc.GetNetworkLocation()
+	}
+
+	return racks
+}
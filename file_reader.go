@@ -0,0 +1,305 @@
+package hdfs
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"errors"
+	"fmt"
+	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
+	"github.com/colinmarc/hdfs/rpc"
+	"io"
+	"sync"
+)
+
+// Read reads up to len(b) bytes from the File. It returns the number of bytes
+// read and an error, if any. EOF is signaled by a zero count with err set to
+// io.EOF.
+func (f *File) Read(b []byte) (int, error) {
+	if f.allowWriting {
+		return 0, errors.New("File is not open for reading.")
+	}
+
+	if f.offset >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	if _, err := f.getBlocksLocked(0, f.info.Size()); err != nil {
+		return 0, err
+	}
+
+	if f.pendingChecksumErr != nil {
+		checksumErr := *f.pendingChecksumErr
+		f.pendingChecksumErr = nil
+		if err := f.failoverBlockReader(checksumErr); err != nil {
+			return 0, err
+		}
+	}
+
+	if f.currentBlockReader == nil {
+		err := f.getNewBlockReader()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	f.startReadahead()
+
+	for {
+		var n int
+		var err error
+		if f.ra != nil {
+			// The readahead goroutine owns currentBlockReader while it's
+			// running; all bytes must come through the channel so the two
+			// goroutines never read the same connection concurrently.
+			n, err = f.readAheadRead(b)
+		} else {
+			n, err = f.currentBlockReader.Read(b)
+		}
+
+		f.offset += int64(n)
+
+		if checksumErr, ok := err.(rpc.ChecksumError); ok {
+			f.stopReadahead()
+			f.currentBlockReader.Close()
+			f.currentBlockReader = nil
+
+			// A checksum error may arrive after some verified bytes have
+			// already been copied into b. Return those bytes now rather
+			// than discarding them, and defer the replica failover to the
+			// start of the next Read call.
+			if n > 0 {
+				f.pendingChecksumErr = &checksumErr
+				return n, nil
+			}
+
+			if retryErr := f.failoverBlockReader(checksumErr); retryErr != nil {
+				return 0, retryErr
+			}
+
+			f.startReadahead()
+			continue
+		} else if err == io.EOF {
+			// End of the current block, not necessarily of the file, so
+			// move on to the next block rather than returning EOF to the
+			// caller prematurely.
+			f.stopReadahead()
+			f.currentBlockReader.Close()
+			f.currentBlockReader = nil
+
+			if n > 0 {
+				return n, nil
+			}
+
+			if f.offset >= f.info.Size() {
+				return 0, io.EOF
+			}
+
+			if err := f.getNewBlockReader(); err != nil {
+				return 0, err
+			}
+
+			f.startReadahead()
+			continue
+		} else if err != nil {
+			f.stopReadahead()
+			f.currentBlockReader.Close()
+			f.currentBlockReader = nil
+			return n, err
+		} else if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// ReadAt reads len(b) bytes from the File starting at byte offset off. It
+// returns the number of bytes read and the error, if any. ReadAt always returns
+// a non-nil error when n < len(b). At end of file, that error is io.EOF.
+//
+// Unlike Read, ReadAt is a true positional read: it does not change f's
+// current offset, does not touch f.currentBlockReader, and is safe to call
+// concurrently with other calls to ReadAt (and with Read) on the same File,
+// matching the io.ReaderAt contract.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	if f.allowWriting {
+		return 0, errors.New("File is not open for reading.")
+	}
+
+	if off < 0 {
+		return 0, errors.New("ReadAt: negative offset")
+	} else if off >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	blocks, err := f.getBlocksLocked(off, int64(len(b)))
+	if err != nil {
+		return 0, err
+	}
+
+	var read int
+	for read < len(b) {
+		curOff := off + int64(read)
+		if curOff >= f.info.Size() {
+			return read, io.EOF
+		}
+
+		block := blockContaining(blocks, uint64(curOff))
+		if block == nil {
+			return read, fmt.Errorf("Couldn't find block for offset: %d", curOff)
+		}
+
+		start := block.GetOffset()
+		excluded := make(map[string]bool)
+		for {
+			br, err := rpc.NewBlockReader(blockExcluding(block, excluded), curOff-int64(start), f.client.checksumPolicy)
+			if err != nil {
+				return read, err
+			}
+
+			n, err := io.ReadFull(br, b[read:minInt(len(b), read+blockRemaining(block, curOff))])
+			br.Close()
+
+			if checksumErr, ok := err.(rpc.ChecksumError); ok {
+				excluded[checksumErr.DataNode] = true
+				if f.client.checksumPolicy == rpc.ChecksumVerifyAndRepair {
+					f.client.reportBadBlock(block, checksumErr.DataNode)
+				}
+				continue
+			}
+
+			read += n
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return read, err
+			}
+
+			break
+		}
+	}
+
+	return read, nil
+}
+
+// blockContaining returns the block covering byte offset off, or nil if none
+// of blocks covers it.
+func blockContaining(blocks []*hdfs.LocatedBlockProto, off uint64) *hdfs.LocatedBlockProto {
+	for _, block := range blocks {
+		start := block.GetOffset()
+		end := start + block.GetB().GetNumBytes()
+		if start <= off && off < end {
+			return block
+		}
+	}
+
+	return nil
+}
+
+// blockRemaining returns how many bytes of block lie at or after the
+// absolute file offset off.
+func blockRemaining(block *hdfs.LocatedBlockProto, off int64) int {
+	end := int64(block.GetOffset() + block.GetB().GetNumBytes())
+	return int(end - off)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// getBlocksLocked returns the cached block list, fetching it from the
+// NameNode on first use. It holds blocksMu only long enough to populate the
+// cache, so it's safe to call from concurrent readers (Read and ReadAt
+// alike).
+func (f *File) getBlocksLocked(off, length int64) ([]*hdfs.LocatedBlockProto, error) {
+	f.blocksMu.Lock()
+	defer f.blocksMu.Unlock()
+
+	if f.blocks == nil {
+		err := f.getBlocks()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f.blocks, nil
+}
+
+func (f *File) getBlocks() error {
+	req := &hdfs.GetBlockLocationsRequestProto{
+		Src:    proto.String(f.name),
+		Offset: proto.Uint64(0),
+		Length: proto.Uint64(uint64(f.info.Size())),
+	}
+	resp := &hdfs.GetBlockLocationsResponseProto{}
+
+	err := f.client.namenode.Execute("getBlockLocations", req, resp)
+	if err != nil {
+		return err
+	}
+
+	f.blocks = resp.GetLocations().GetBlocks()
+	return nil
+}
+
+func (f *File) getNewBlockReader() error {
+	off := uint64(f.offset)
+	block := blockContaining(f.blocks, off)
+	if block == nil {
+		return fmt.Errorf("Couldn't find block for offset: %d", off)
+	}
+
+	// excludedLocs only ever records failures against the block we were
+	// just reading; a DataNode that failed a checksum on one block may be
+	// perfectly healthy for another, so it shouldn't stay excluded once we
+	// move on.
+	if f.excludedBlock != block {
+		f.excludedLocs = nil
+		f.excludedBlock = block
+	}
+
+	start := block.GetOffset()
+	br, err := rpc.NewBlockReader(blockExcluding(block, f.excludedLocs), off-start, f.client.checksumPolicy)
+	if err != nil {
+		return err
+	}
+
+	f.currentBlockReader = br
+	return nil
+}
+
+// failoverBlockReader is called after a ChecksumError from the current
+// block reader. It excludes the replica that served the corrupt data and
+// opens a new block reader against the next replica in the block's
+// location list, surfacing an error only once every replica has failed.
+func (f *File) failoverBlockReader(checksumErr rpc.ChecksumError) error {
+	if f.excludedLocs == nil {
+		f.excludedLocs = make(map[string]bool)
+	}
+	f.excludedLocs[checksumErr.DataNode] = true
+
+	if f.client.checksumPolicy == rpc.ChecksumVerifyAndRepair {
+		f.client.reportBadBlock(f.excludedBlock, checksumErr.DataNode)
+	}
+
+	return f.getNewBlockReader()
+}
+
+// blockExcluding returns a shallow copy of block with any DataNode locations
+// present in excluded removed, so that rpc.NewBlockReader skips replicas
+// that have already failed a checksum check.
+func blockExcluding(block *hdfs.LocatedBlockProto, excluded map[string]bool) *hdfs.LocatedBlockProto {
+	if len(excluded) == 0 {
+		return block
+	}
+
+	locs := block.GetLocs()
+	kept := make([]*hdfs.DatanodeInfoProto, 0, len(locs))
+	for _, loc := range locs {
+		if !excluded[loc.GetId().GetHostName()] {
+			kept = append(kept, loc)
+		}
+	}
+
+	filtered := *block
+	filtered.Locs = kept
+	return &filtered
+}
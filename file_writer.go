@@ -0,0 +1,238 @@
+package hdfs
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"errors"
+	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
+	"github.com/colinmarc/hdfs/rpc"
+	"os"
+)
+
+// blockSize is the default HDFS block size used for files created by this
+// client. It matches the historical Hadoop default of 64 MB.
+const blockSize = 64 * 1024 * 1024
+
+// Create creates a new file at name with the default permissions (0644) and
+// returns a File opened for writing. It is equivalent to
+// OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644).
+func (c *Client) Create(name string) (*File, error) {
+	return c.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// OpenFile opens a File for writing, creating or truncating it as directed by
+// flag, which should include exactly one of os.O_WRONLY or os.O_RDWR along
+// with any combination of os.O_CREATE, os.O_APPEND, and os.O_TRUNC. Reading
+// and writing to the same File is not currently supported; O_RDWR is accepted
+// for compatibility, but behaves like O_WRONLY.
+//
+// perm sets the permissions of a file that OpenFile creates, or overwrites
+// because of O_TRUNC; it has no effect when appending to an existing file.
+func (c *Client) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return nil, errors.New("OpenFile: flag must include O_WRONLY or O_RDWR")
+	}
+
+	info, err := c.getFileInfo(name)
+	exists := err == nil
+
+	if !exists && flag&os.O_CREATE == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	if exists && flag&os.O_APPEND != 0 {
+		req := &hdfs.AppendRequestProto{
+			Src:        proto.String(name),
+			ClientName: proto.String(clientName),
+		}
+		resp := &hdfs.AppendResponseProto{}
+
+		err := c.namenode.Execute("append", req, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		f := &File{
+			client:       c,
+			name:         name,
+			info:         info,
+			offset:       info.Size(),
+			flag:         flag,
+			lastBlock:    resp.GetBlock(),
+			allowWriting: true,
+		}
+
+		// If the file's last block isn't yet full, resume writing to it
+		// instead of starting a new block on the first Write; otherwise the
+		// bytes already in that block would be orphaned.
+		if last := resp.GetBlock(); last != nil && last.GetB().GetNumBytes() < blockSize {
+			bw, err := rpc.ResumeBlockWriter(last, blockSize)
+			if err != nil {
+				return nil, err
+			}
+
+			f.currentBlockWriter = bw
+		}
+
+		return f, nil
+	}
+
+	req := &hdfs.CreateRequestProto{
+		Src:          proto.String(name),
+		Masked:       &hdfs.FsPermissionProto{Perm: proto.Uint32(uint32(perm.Perm()))},
+		ClientName:   proto.String(clientName),
+		CreateFlag:   proto.Uint32(createFlags(flag)),
+		CreateParent: proto.Bool(true),
+		Replication:  proto.Uint32(3),
+		BlockSize:    proto.Uint64(blockSize),
+	}
+	resp := &hdfs.CreateResponseProto{}
+
+	err = c.namenode.Execute("create", req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	newInfo, err := c.getFileInfo(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		client:       c,
+		name:         name,
+		info:         newInfo,
+		flag:         flag,
+		allowWriting: true,
+	}, nil
+}
+
+func createFlags(flag int) uint32 {
+	var f uint32 = 1 // CREATE
+	if flag&os.O_APPEND != 0 {
+		f |= 4 // APPEND
+	}
+	if flag&os.O_TRUNC != 0 {
+		f |= 2 // OVERWRITE
+	}
+
+	return f
+}
+
+// Write writes len(b) bytes to the File. It returns the number of bytes
+// written and an error, if any. Write returns a non-nil error when n <
+// len(b). Writes are buffered and streamed to the DataNode pipeline in
+// packets; callers that need the data flushed to disk should use Close.
+func (f *File) Write(b []byte) (int, error) {
+	if !f.allowWriting {
+		return 0, errors.New("File is not open for writing.")
+	}
+
+	if f.writeErr != nil {
+		return 0, f.writeErr
+	}
+
+	var written int
+	for len(b) > 0 {
+		if f.currentBlockWriter == nil {
+			err := f.startNewBlock()
+			if err != nil {
+				f.writeErr = err
+				return written, err
+			}
+		}
+
+		n, err := f.currentBlockWriter.Write(b)
+		written += n
+		f.offset += int64(n)
+		b = b[n:]
+
+		if err == rpc.ErrEndOfBlock {
+			err = f.finishBlock()
+			if err != nil {
+				f.writeErr = err
+				return written, err
+			}
+
+			continue
+		} else if err != nil {
+			f.writeErr = err
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// Truncate changes the size of the file to size with a truncate call to the
+// NameNode. It returns an error once f's offset is non-zero: after any data
+// has been written through f, or when f was opened with O_APPEND on a
+// non-empty file.
+func (f *File) Truncate(size int64) error {
+	if !f.allowWriting {
+		return errors.New("File is not open for writing.")
+	}
+
+	if f.currentBlockWriter != nil || f.offset != 0 {
+		return errors.New("Truncate must be called before any data is written.")
+	}
+
+	req := &hdfs.TruncateRequestProto{
+		Src:        proto.String(f.name),
+		NewLength:  proto.Uint64(uint64(size)),
+		ClientName: proto.String(clientName),
+	}
+	resp := &hdfs.TruncateResponseProto{}
+
+	return f.client.namenode.Execute("truncate", req, resp)
+}
+
+func (f *File) startNewBlock() error {
+	req := &hdfs.AddBlockRequestProto{
+		Src:        proto.String(f.name),
+		ClientName: proto.String(clientName),
+		Previous:   f.lastBlock.GetB(),
+	}
+	resp := &hdfs.AddBlockResponseProto{}
+
+	err := f.client.namenode.Execute("addBlock", req, resp)
+	if err != nil {
+		return err
+	}
+
+	block := resp.GetBlock()
+	bw, err := rpc.NewBlockWriter(block, blockSize)
+	if err != nil {
+		return err
+	}
+
+	f.currentBlockWriter = bw
+	f.lastBlock = block
+	return nil
+}
+
+func (f *File) finishBlock() error {
+	err := f.currentBlockWriter.Close()
+	f.currentBlockWriter = nil
+	return err
+}
+
+func (f *File) closeForWriting() error {
+	f.closed = true
+
+	if f.currentBlockWriter != nil {
+		err := f.currentBlockWriter.Close()
+		f.currentBlockWriter = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	req := &hdfs.CompleteRequestProto{
+		Src:        proto.String(f.name),
+		ClientName: proto.String(clientName),
+		Last:       f.lastBlock.GetB(),
+	}
+	resp := &hdfs.CompleteResponseProto{}
+
+	return f.client.namenode.Execute("complete", req, resp)
+}
@@ -0,0 +1,129 @@
+package hdfs
+
+import (
+	"io"
+	"io/fs"
+	"path"
+)
+
+// FS returns an fs.FS backed by this Client, rooted at the HDFS root
+// directory. The returned value also implements fs.ReadDirFS, fs.StatFS,
+// fs.GlobFS, and fs.SubFS, so it can be used directly with fs.WalkDir,
+// fs.Glob, http.FS, and similar io/fs-based APIs.
+//
+// Client.Open can't implement fs.FS itself, since it already returns the
+// more capable *File (with Seek, Write, Readdir, and so on) rather than the
+// bare fs.File interface; FS is the adapter for callers that specifically
+// need an fs.FS.
+func (c *Client) FS() fs.FS {
+	return (*clientFS)(c)
+}
+
+// clientFS adapts a Client to the io/fs interfaces. It shares the same
+// underlying fields as Client, so the conversion is free.
+type clientFS Client
+
+func (cfs *clientFS) client() *Client {
+	return (*Client)(cfs)
+}
+
+// Open opens the named file for reading, implementing fs.FS. name must
+// satisfy fs.ValidPath: slash-separated, not rooted, and "." for the HDFS
+// root.
+func (cfs *clientFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return cfs.client().Open(toHdfsPath(name))
+}
+
+// ReadDir reads the named directory and returns a list of directory
+// entries, implementing fs.ReadDirFS.
+func (cfs *clientFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := cfs.client().Open(toHdfsPath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.ReadDir(-1)
+}
+
+// Stat returns an fs.FileInfo describing the named file, implementing
+// fs.StatFS.
+func (cfs *clientFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return cfs.client().getFileInfo(toHdfsPath(name))
+}
+
+// Glob returns the names of all files matching pattern, implementing
+// fs.GlobFS.
+func (cfs *clientFS) Glob(pattern string) ([]string, error) {
+	// Hide Glob from fs.Glob, which would otherwise call straight back here.
+	return fs.Glob(struct{ fs.ReadDirFS }{cfs}, pattern)
+}
+
+// Sub returns an fs.FS corresponding to the subtree rooted at dir,
+// implementing fs.SubFS.
+func (cfs *clientFS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+
+	return &subFS{cfs: cfs, dir: dir}, nil
+}
+
+// subFS implements fs.FS for the subtree rooted at dir within a clientFS.
+type subFS struct {
+	cfs *clientFS
+	dir string
+}
+
+func (s *subFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return s.cfs.Open(path.Join(s.dir, name))
+}
+
+// toHdfsPath converts an fs.FS-shaped path (slash-separated, "." for the
+// root, never rooted) into the absolute HDFS path this package's other
+// methods expect.
+func toHdfsPath(name string) string {
+	if name == "." {
+		return "/"
+	}
+
+	return "/" + name
+}
+
+// ReadDir reads up to n directory entries, implementing fs.ReadDirFile. If
+// n <= 0, it returns every entry in the directory, starting again from the
+// first.
+func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	infos, err := f.Readdir(n)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+
+	return entries, err
+}
+
+// Stat returns the fs.FileInfo for the file, implementing fs.File.
+func (f *File) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
@@ -0,0 +1,159 @@
+package hdfs
+
+import (
+	"io"
+)
+
+// defaultReadaheadBytes is a 1 MiB readahead size. Nothing in this package
+// applies it: readahead stays off until SetReadahead is given a positive size.
+const defaultReadaheadBytes = 1 << 20 // 1 MiB
+
+// readaheadItem is a single value produced by the readahead goroutine: a
+// chunk of data, or the terminal error that followed it. Carrying both in
+// one ordered channel guarantees the consumer sees every buffered chunk
+// before the error that ended the stream, which two separate channels
+// can't: a select between a data channel and an errs channel picks between
+// ready cases at random, so it can surface the error while chunks are
+// still sitting in the data channel's buffer.
+type readaheadItem struct {
+	buf []byte
+	err error
+}
+
+// readahead manages a background goroutine that keeps a bounded buffer of
+// upcoming data from the current block filled in while the caller drains it,
+// so that Read doesn't wait on each read from the DataNode. It does not
+// pre-open the next block: once the current block is exhausted, Read opens
+// the next block reader itself and waits for that DataNode handshake.
+//
+// Once a readahead is running, it takes sole ownership of the
+// rpc.BlockReader it was started against: only the goroutine in run ever
+// calls Read on it. The foreground File.Read must get all of its bytes from
+// items (via File.readAheadRead) for as long as f.ra is non-nil, never by
+// reading currentBlockReader directly, or the two goroutines would race on
+// the same TCP stream.
+type readahead struct {
+	size int
+
+	items chan readaheadItem
+	stop  chan struct{}
+	done  chan struct{}
+
+	// leftover holds bytes already pulled off items that didn't fit in the
+	// caller's buffer. It's only ever touched by the consumer
+	// (File.readAheadRead), never by the producer goroutine, so no
+	// synchronization is needed for it.
+	leftover []byte
+}
+
+// SetReadahead enables readahead prefetching for files opened by this
+// Client, reading ahead in chunks of up to the given size in bytes, with up
+// to four chunks held ahead of the caller. It only affects Files opened
+// after the call. A size of 0 disables readahead.
+func (c *Client) SetReadahead(bytes int) {
+	c.readaheadBytes = bytes
+}
+
+// SetReadahead enables or updates readahead prefetching for f, reading ahead
+// in chunks of up to the given size in bytes, with up to four chunks held
+// ahead of the caller. It takes effect on the next Read call. A size of 0
+// disables readahead and stops any in-flight prefetch.
+func (f *File) SetReadahead(bytes int) {
+	if f.ra != nil {
+		// The prefetcher has read past f.offset; its buffered bytes are
+		// dropped, so the next Read must reopen the block at f.offset.
+		f.stopReadahead()
+		if f.currentBlockReader != nil {
+			f.currentBlockReader.Close()
+			f.currentBlockReader = nil
+		}
+	}
+	f.readaheadBytes = bytes
+}
+
+// startReadahead launches the background prefetcher for the block currently
+// being read, if readahead is enabled and not already running.
+func (f *File) startReadahead() {
+	if f.readaheadBytes <= 0 || f.ra != nil || f.currentBlockReader == nil {
+		return
+	}
+
+	ra := &readahead{
+		size:  f.readaheadBytes,
+		items: make(chan readaheadItem, 4),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	br := f.currentBlockReader
+	go ra.run(br)
+
+	f.ra = ra
+}
+
+func (ra *readahead) run(r io.Reader) {
+	defer close(ra.done)
+
+	for {
+		buf := make([]byte, ra.size)
+		n, err := r.Read(buf)
+
+		if n > 0 {
+			select {
+			case ra.items <- readaheadItem{buf: buf[:n]}:
+			case <-ra.stop:
+				return
+			}
+		}
+
+		if err != nil {
+			select {
+			case ra.items <- readaheadItem{err: err}:
+			case <-ra.stop:
+			}
+			return
+		}
+	}
+}
+
+// stopReadahead cancels any in-flight prefetch for f. It's called from
+// Seek, Close and SetReadahead, since all three invalidate the current
+// block reader, and
+// whenever Read is about to take back ownership of currentBlockReader (on
+// an error or a block boundary).
+func (f *File) stopReadahead() {
+	if f.ra == nil {
+		return
+	}
+
+	close(f.ra.stop)
+	<-f.ra.done
+	f.ra = nil
+}
+
+// readAheadRead serves a Read call entirely out of the prefetch buffer. It
+// must only be called while f.ra is non-nil, and blocks until the
+// background goroutine has produced the next item — it never falls back to
+// reading f.currentBlockReader itself, since the goroutine already owns
+// that reader. Because items arrive in a single ordered channel, every
+// buffered chunk is consumed before the error that followed it ever surfaces.
+func (f *File) readAheadRead(b []byte) (int, error) {
+	ra := f.ra
+
+	if len(ra.leftover) > 0 {
+		n := copy(b, ra.leftover)
+		ra.leftover = ra.leftover[n:]
+		return n, nil
+	}
+
+	item := <-ra.items
+	if item.err != nil {
+		return 0, item.err
+	}
+
+	n := copy(b, item.buf)
+	if n < len(item.buf) {
+		ra.leftover = item.buf[n:]
+	}
+	return n, nil
+}
@@ -0,0 +1,172 @@
+package rpc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
+	"hash/crc32"
+	"io"
+	"net"
+)
+
+// BlockReader implements io.ReadCloser, for use reading a single block off
+// a DataNode over the Data Transfer Protocol. It is the read-side
+// counterpart to BlockWriter.
+type BlockReader struct {
+	block  *hdfs.LocatedBlockProto
+	policy ChecksumPolicy
+
+	locIdx        int
+	conn          net.Conn
+	in            *bufio.Reader
+	bytesPerChunk int
+
+	offset int64 // the block offset the next byte returned by Read corresponds to
+	remain int64 // bytes left to read from the block
+
+	packet []byte // checksum-verified data from the current packet, not yet consumed
+}
+
+// NewBlockReader returns a BlockReader positioned at the given offset
+// within block, connecting to the first replica in block.GetLocs() and
+// falling back to the next one on a connection or handshake failure.
+// policy controls whether the checksums the DataNode sends inline with
+// each packet are verified as they're consumed.
+func NewBlockReader(block *hdfs.LocatedBlockProto, offset int64, policy ChecksumPolicy) (*BlockReader, error) {
+	br := &BlockReader{
+		block:  block,
+		policy: policy,
+		offset: offset,
+		remain: int64(block.GetB().GetNumBytes()) - offset,
+	}
+
+	if err := br.connect(); err != nil {
+		return nil, err
+	}
+
+	return br, nil
+}
+
+func (br *BlockReader) connect() error {
+	locs := br.block.GetLocs()
+	for br.locIdx < len(locs) {
+		loc := locs[br.locIdx]
+		br.locIdx++
+
+		addr := fmt.Sprintf("%s:%d", loc.GetId().GetIpAddr(), loc.GetId().GetXferPort())
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			continue
+		}
+
+		in := bufio.NewReader(conn)
+		if err := writeBlockReadHeader(conn, br.block, br.offset, br.remain); err != nil {
+			conn.Close()
+			continue
+		}
+
+		checksumInfo, err := readBlockOpResponse(in)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+
+		bytesPerChunk := int(checksumInfo.GetChecksum().GetBytesPerChecksum())
+		if bytesPerChunk == 0 {
+			bytesPerChunk = chunkSize
+		}
+
+		br.conn = conn
+		br.in = in
+		br.bytesPerChunk = bytesPerChunk
+		return nil
+	}
+
+	return errors.New("rpc: no more replicas available for this block")
+}
+
+// Read reads up to len(b) bytes from the block. Unless policy is
+// ChecksumSkip, the CRC32C checksum of each chunk is verified as it's
+// consumed; a mismatch is returned as a ChecksumError identifying the
+// block, the replica that served it, and the offset of the failing chunk.
+// The caller should treat a ChecksumError as fatal to this BlockReader and
+// fail over to another replica rather than retry it.
+func (br *BlockReader) Read(b []byte) (int, error) {
+	if len(br.packet) == 0 {
+		if br.remain <= 0 {
+			return 0, io.EOF
+		}
+
+		if err := br.readNextPacket(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, br.packet)
+	br.packet = br.packet[n:]
+	br.offset += int64(n)
+	br.remain -= int64(n)
+
+	return n, nil
+}
+
+func (br *BlockReader) readNextPacket() error {
+	hdr, checksums, data, err := readPacketHeader(br.in, int64(br.bytesPerChunk))
+	if err != nil {
+		return err
+	}
+
+	if br.policy != ChecksumSkip {
+		if badOffset, ok := firstBadChunk(data, checksums, br.bytesPerChunk); ok {
+			return ChecksumError{
+				Block:    br.block.GetB().String(),
+				DataNode: br.currentDataNode(),
+				Offset:   hdr.GetOffsetInBlock() + int64(badOffset),
+			}
+		}
+	}
+
+	br.packet = data
+	return nil
+}
+
+// currentDataNode returns the hostname of the replica this BlockReader is
+// currently connected to.
+func (br *BlockReader) currentDataNode() string {
+	locs := br.block.GetLocs()
+	if br.locIdx == 0 || br.locIdx > len(locs) {
+		return ""
+	}
+
+	return locs[br.locIdx-1].GetId().GetHostName()
+}
+
+// firstBadChunk verifies the CRC32C of each bytesPerChunk-sized span of
+// data against checksums, returning the byte offset (relative to data) of
+// the first span whose checksum doesn't match.
+func firstBadChunk(data []byte, checksums []uint32, bytesPerChunk int) (int, bool) {
+	for i, off := 0, 0; off < len(data); i++ {
+		n := bytesPerChunk
+		if off+n > len(data) {
+			n = len(data) - off
+		}
+
+		if crc32.Checksum(data[off:off+n], crc32cTable) != checksums[i] {
+			return off, true
+		}
+
+		off += n
+	}
+
+	return 0, false
+}
+
+// Close closes the underlying connection to the DataNode.
+func (br *BlockReader) Close() error {
+	if br.conn == nil {
+		return nil
+	}
+
+	return br.conn.Close()
+}
@@ -0,0 +1,220 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/goprotobuf/proto"
+	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
+	"io"
+	"net"
+	"testing"
+)
+
+// fakeReadDataNode is a minimal DataNode-side implementation of the read
+// path of the Data Transfer Protocol: it accepts one OP_READ_BLOCK
+// handshake and streams back a single packet holding data, optionally
+// with a corrupted checksum to simulate an on-disk or on-wire bitflip.
+type fakeReadDataNode struct {
+	ln       net.Listener
+	data     []byte
+	corrupt  bool
+	hostName string
+}
+
+func newFakeReadDataNode(t *testing.T, data []byte, corrupt bool, hostName string) *fakeReadDataNode {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	dn := &fakeReadDataNode{ln: ln, data: data, corrupt: corrupt, hostName: hostName}
+	go dn.serve(t)
+	return dn
+}
+
+func (dn *fakeReadDataNode) addr() (string, int) {
+	tcpAddr := dn.ln.Addr().(*net.TCPAddr)
+	return tcpAddr.IP.String(), tcpAddr.Port
+}
+
+func (dn *fakeReadDataNode) serve(t *testing.T) {
+	conn, err := dn.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	in := bufio.NewReader(conn)
+
+	var hdr [3]byte
+	if _, err := in.Read(hdr[:]); err != nil {
+		t.Errorf("fake datanode: read op header: %v", err)
+		return
+	}
+
+	req := &hdfs.OpReadBlockProto{}
+	if err := readDelimited(in, req); err != nil {
+		t.Errorf("fake datanode: read OpReadBlockProto: %v", err)
+		return
+	}
+
+	out := bufio.NewWriter(conn)
+	resp := &hdfs.BlockOpResponseProto{
+		Status: hdfs.Status_SUCCESS.Enum(),
+		ReadOpChecksumInfo: &hdfs.ReadOpChecksumInfoProto{
+			Checksum: &hdfs.ChecksumProto{
+				Type:             hdfs.ChecksumTypeProto_CHECKSUM_CRC32C.Enum(),
+				BytesPerChecksum: proto.Uint32(chunkSize),
+			},
+			ChunkOffset: proto.Uint64(0),
+		},
+	}
+	if err := writeDelimited(out, resp); err != nil {
+		t.Errorf("fake datanode: write BlockOpResponseProto: %v", err)
+		return
+	}
+
+	checksums := checksumChunks(dn.data)
+	if dn.corrupt {
+		checksums[0] ^= 0xffffffff
+	}
+
+	packetHdr := &hdfs.PacketHeaderProto{
+		OffsetInBlock:     proto.Int64(0),
+		Seqno:             proto.Int64(0),
+		LastPacketInBlock: proto.Bool(true),
+		DataLen:           proto.Int32(int32(len(dn.data))),
+	}
+	hdrBytes, _ := proto.Marshal(packetHdr)
+
+	packetLen := int32(len(checksums)*4) + int32(len(dn.data)) + 4
+	var buf bytes.Buffer
+	writeBE32(&buf, packetLen)
+	writeBE16(&buf, int16(len(hdrBytes)))
+	buf.Write(hdrBytes)
+	for _, c := range checksums {
+		writeBE32(&buf, int32(c))
+	}
+	buf.Write(dn.data)
+
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		t.Errorf("fake datanode: write packet: %v", err)
+		return
+	}
+	if err := out.Flush(); err != nil {
+		t.Errorf("fake datanode: flush packet: %v", err)
+	}
+}
+
+func writeBE32(buf *bytes.Buffer, v int32) {
+	buf.WriteByte(byte(v >> 24))
+	buf.WriteByte(byte(v >> 16))
+	buf.WriteByte(byte(v >> 8))
+	buf.WriteByte(byte(v))
+}
+
+func writeBE16(buf *bytes.Buffer, v int16) {
+	buf.WriteByte(byte(v >> 8))
+	buf.WriteByte(byte(v))
+}
+
+func readBlockWithReplicas(numBytes uint64, replicas []*hdfs.DatanodeInfoProto) *hdfs.LocatedBlockProto {
+	return &hdfs.LocatedBlockProto{
+		B: &hdfs.ExtendedBlockProto{
+			PoolId:          proto.String("pool"),
+			BlockId:         proto.Uint64(1),
+			GenerationStamp: proto.Uint64(1),
+			NumBytes:        proto.Uint64(numBytes),
+		},
+		Locs: replicas,
+	}
+}
+
+func replicaFor(dn *fakeReadDataNode) *hdfs.DatanodeInfoProto {
+	ip, port := dn.addr()
+	return &hdfs.DatanodeInfoProto{
+		Id: &hdfs.DatanodeIDProto{
+			IpAddr:   proto.String(ip),
+			HostName: proto.String(dn.hostName),
+			XferPort: proto.Uint32(uint32(port)),
+		},
+	}
+}
+
+// TestBlockReaderVerifiesChecksum checks that a single corrupt replica
+// causes Read to return a ChecksumError naming that replica.
+func TestBlockReaderVerifiesChecksum(t *testing.T) {
+	payload := []byte("the quick brown fox jumps over the lazy dog")
+	dn := newFakeReadDataNode(t, payload, true, "bad-datanode")
+
+	block := readBlockWithReplicas(uint64(len(payload)), []*hdfs.DatanodeInfoProto{replicaFor(dn)})
+	br, err := NewBlockReader(block, 0, ChecksumVerify)
+	if err != nil {
+		t.Fatalf("NewBlockReader: %v", err)
+	}
+	defer br.Close()
+
+	buf := make([]byte, len(payload))
+	_, err = io.ReadFull(br, buf)
+
+	checksumErr, ok := err.(ChecksumError)
+	if !ok {
+		t.Fatalf("Read: expected ChecksumError, got %v", err)
+	}
+	if checksumErr.DataNode != "bad-datanode" {
+		t.Fatalf("ChecksumError.DataNode = %q, want %q", checksumErr.DataNode, "bad-datanode")
+	}
+}
+
+// TestBlockReaderFailover simulates a file_reader.go-style caller: on a
+// ChecksumError from the first replica, it excludes that replica and
+// opens a new BlockReader against the rest of the locations, which should
+// succeed against the healthy replica.
+func TestBlockReaderFailover(t *testing.T) {
+	payload := []byte("the quick brown fox jumps over the lazy dog")
+	badDN := newFakeReadDataNode(t, payload, true, "bad-datanode")
+	goodDN := newFakeReadDataNode(t, payload, false, "good-datanode")
+
+	block := readBlockWithReplicas(uint64(len(payload)), []*hdfs.DatanodeInfoProto{
+		replicaFor(badDN),
+		replicaFor(goodDN),
+	})
+
+	br, err := NewBlockReader(block, 0, ChecksumVerify)
+	if err != nil {
+		t.Fatalf("NewBlockReader: %v", err)
+	}
+
+	buf := make([]byte, len(payload))
+	_, err = io.ReadFull(br, buf)
+	br.Close()
+
+	checksumErr, ok := err.(ChecksumError)
+	if !ok {
+		t.Fatalf("Read: expected ChecksumError from first replica, got %v", err)
+	}
+
+	excluded := map[string]bool{checksumErr.DataNode: true}
+	var kept []*hdfs.DatanodeInfoProto
+	for _, loc := range block.GetLocs() {
+		if !excluded[loc.GetId().GetHostName()] {
+			kept = append(kept, loc)
+		}
+	}
+	failoverBlock := *block
+	failoverBlock.Locs = kept
+
+	br2, err := NewBlockReader(&failoverBlock, 0, ChecksumVerify)
+	if err != nil {
+		t.Fatalf("NewBlockReader (failover): %v", err)
+	}
+	defer br2.Close()
+
+	n, err := io.ReadFull(br2, buf)
+	if err != nil {
+		t.Fatalf("Read (failover): %v", err)
+	}
+	if n != len(payload) || string(buf) != string(payload) {
+		t.Fatalf("Read (failover) = %q, want %q", buf[:n], payload)
+	}
+}
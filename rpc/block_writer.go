@@ -0,0 +1,199 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
+	"hash/crc32"
+	"net"
+)
+
+// chunkSize is the number of bytes covered by a single CRC32C checksum, as
+// defined by the Data Transfer Protocol.
+const chunkSize = 512
+
+// defaultPacketSize is the default amount of user data carried by a single
+// packet, absent any other configuration.
+const defaultPacketSize = 64 * 1024
+
+// ErrEndOfBlock is returned by BlockWriter.Write when the block has reached
+// its configured capacity. The caller should addBlock on the NameNode and
+// construct a new BlockWriter for the next block.
+var ErrEndOfBlock = errors.New("rpc: end of block")
+
+// crc32cTable is used for the per-chunk checksums required by the wire
+// protocol.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// BlockWriter implements io.WriteCloser, for use writing a single block to a
+// pipeline of DataNodes, over the Data Transfer Protocol. It is the write-side
+// counterpart to BlockReader.
+type BlockWriter struct {
+	block     *hdfs.LocatedBlockProto
+	blockSize int64
+	stage     hdfs.OpWriteBlockProto_BlockConstructionStage
+
+	conn   net.Conn
+	out    *bufio.Writer
+	in     *bufio.Reader
+	locIdx int
+
+	seqno   int64
+	written int64
+}
+
+// NewBlockWriter returns a BlockWriter that writes a brand new block,
+// connecting to the first replica in the block's pipeline and falling back
+// to subsequent replicas in block.GetLocs() if the connection fails.
+// blockSize is the maximum number of bytes that may be written to the
+// block before Write starts returning ErrEndOfBlock.
+func NewBlockWriter(block *hdfs.LocatedBlockProto, blockSize int64) (*BlockWriter, error) {
+	return newBlockWriter(block, blockSize, 0, hdfs.OpWriteBlockProto_PIPELINE_SETUP_CREATE)
+}
+
+// ResumeBlockWriter returns a BlockWriter that continues filling an
+// existing, not-yet-full block returned by an append call, rather than
+// starting a new one. block.GetB().GetNumBytes() is used as the number of
+// bytes the block already holds.
+func ResumeBlockWriter(block *hdfs.LocatedBlockProto, blockSize int64) (*BlockWriter, error) {
+	written := int64(block.GetB().GetNumBytes())
+	return newBlockWriter(block, blockSize, written, hdfs.OpWriteBlockProto_PIPELINE_SETUP_APPEND)
+}
+
+func newBlockWriter(block *hdfs.LocatedBlockProto, blockSize, written int64, stage hdfs.OpWriteBlockProto_BlockConstructionStage) (*BlockWriter, error) {
+	bw := &BlockWriter{block: block, blockSize: blockSize, written: written, stage: stage}
+
+	if err := bw.connectNext(); err != nil {
+		return nil, err
+	}
+
+	return bw, nil
+}
+
+func (bw *BlockWriter) connectNext() error {
+	locs := bw.block.GetLocs()
+	for bw.locIdx < len(locs) {
+		loc := locs[bw.locIdx]
+		bw.locIdx++
+
+		addr := fmt.Sprintf("%s:%d", loc.GetId().GetIpAddr(), loc.GetId().GetXferPort())
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			continue
+		}
+
+		in := bufio.NewReader(conn)
+		if err := writeBlockWriteHeader(conn, in, bw.block, locs[bw.locIdx-1:], bw.stage, uint64(bw.written)); err != nil {
+			conn.Close()
+			continue
+		}
+
+		bw.conn = conn
+		bw.out = bufio.NewWriter(conn)
+		bw.in = in
+		return nil
+	}
+
+	return errors.New("rpc: no more replicas available for this block")
+}
+
+// Write writes len(b) bytes to the block pipeline, chunked into 512-byte
+// checksummed spans and batched into packets of up to defaultPacketSize
+// bytes. It returns ErrEndOfBlock once the block has reached its configured
+// capacity; the caller should not call Write again on this BlockWriter after
+// that point.
+func (bw *BlockWriter) Write(b []byte) (int, error) {
+	var written int
+
+	for len(b) > 0 {
+		if bw.written >= bw.blockSize {
+			return written, ErrEndOfBlock
+		}
+
+		n := len(b)
+		if max := int(bw.blockSize - bw.written); n > max {
+			n = max
+		}
+		if n > defaultPacketSize {
+			n = defaultPacketSize
+		}
+
+		err := bw.sendPacket(b[:n], false)
+		if err != nil {
+			if err = bw.failover(); err != nil {
+				return written, err
+			}
+			continue
+		}
+
+		written += n
+		bw.written += int64(n)
+		b = b[n:]
+	}
+
+	return written, nil
+}
+
+func (bw *BlockWriter) failover() error {
+	if bw.conn != nil {
+		bw.conn.Close()
+	}
+
+	return bw.connectNext()
+}
+
+func (bw *BlockWriter) sendPacket(data []byte, last bool) error {
+	if err := writePacketHeader(bw.out, bw.seqno, bw.written, int64(len(data)), last); err != nil {
+		return err
+	}
+
+	checksums := checksumChunks(data)
+	for _, c := range checksums {
+		if err := binary.Write(bw.out, binary.BigEndian, c); err != nil {
+			return err
+		}
+	}
+
+	if _, err := bw.out.Write(data); err != nil {
+		return err
+	}
+	if err := bw.out.Flush(); err != nil {
+		return err
+	}
+
+	bw.seqno++
+	return readPacketAck(bw.in)
+}
+
+func checksumChunks(data []byte) []uint32 {
+	sums := make([]uint32, 0, numChunks(int64(len(data)), chunkSize))
+	for len(data) > 0 {
+		n := chunkSize
+		if n > len(data) {
+			n = len(data)
+		}
+
+		sums = append(sums, crc32.Checksum(data[:n], crc32cTable))
+		data = data[n:]
+	}
+
+	return sums
+}
+
+// Close flushes the final, zero-length packet marked as the last packet in
+// the block, and waits for the pipeline to acknowledge it.
+func (bw *BlockWriter) Close() error {
+	if bw.out == nil {
+		return nil
+	}
+
+	err := bw.sendPacket(nil, true)
+	if err != nil {
+		bw.conn.Close()
+		return err
+	}
+
+	return bw.conn.Close()
+}
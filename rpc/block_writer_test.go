@@ -0,0 +1,205 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/goprotobuf/proto"
+	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
+	"net"
+	"testing"
+)
+
+// fakeDataNode is a minimal DataNode-side implementation of the write path
+// of the Data Transfer Protocol, enough to exercise BlockWriter end to end:
+// it accepts one OP_WRITE_BLOCK handshake, acks every packet, and records
+// the bytes it received.
+type fakeDataNode struct {
+	ln       net.Listener
+	received bytes.Buffer
+	lastSeen bool
+}
+
+func newFakeDataNode(t *testing.T) *fakeDataNode {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	dn := &fakeDataNode{ln: ln}
+	go dn.serve(t)
+	return dn
+}
+
+func (dn *fakeDataNode) addr() (string, int) {
+	tcpAddr := dn.ln.Addr().(*net.TCPAddr)
+	return tcpAddr.IP.String(), tcpAddr.Port
+}
+
+func (dn *fakeDataNode) serve(t *testing.T) {
+	conn, err := dn.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	in := bufio.NewReader(conn)
+
+	var hdr [3]byte
+	if _, err := in.Read(hdr[:]); err != nil {
+		t.Errorf("fake datanode: read op header: %v", err)
+		return
+	}
+
+	req := &hdfs.OpWriteBlockProto{}
+	if err := readDelimited(in, req); err != nil {
+		t.Errorf("fake datanode: read OpWriteBlockProto: %v", err)
+		return
+	}
+
+	out := bufio.NewWriter(conn)
+	resp := &hdfs.BlockOpResponseProto{Status: hdfs.Status_SUCCESS.Enum()}
+	if err := writeDelimited(out, resp); err != nil {
+		t.Errorf("fake datanode: write BlockOpResponseProto: %v", err)
+		return
+	}
+	if err := out.Flush(); err != nil {
+		t.Errorf("fake datanode: flush handshake: %v", err)
+		return
+	}
+
+	for {
+		packetHdr, _, data, err := readPacketHeader(in, chunkSize)
+		if err != nil {
+			return
+		}
+
+		dn.received.Write(data)
+
+		// Record the last packet before acking it, since the client's Close
+		// returns as soon as it reads the ack.
+		last := packetHdr.GetLastPacketInBlock()
+		if last {
+			dn.lastSeen = true
+		}
+
+		if err := writePacketAck(out, packetHdr.GetSeqno(), hdfs.Status_SUCCESS); err != nil {
+			t.Errorf("fake datanode: write ack: %v", err)
+			return
+		}
+
+		if last {
+			return
+		}
+	}
+}
+
+func testBlock(dn *fakeDataNode, numBytes uint64) *hdfs.LocatedBlockProto {
+	ip, port := dn.addr()
+
+	return &hdfs.LocatedBlockProto{
+		B: &hdfs.ExtendedBlockProto{
+			PoolId:       proto.String("pool"),
+			BlockId:      proto.Uint64(1),
+			GenerationStamp: proto.Uint64(1),
+			NumBytes:     proto.Uint64(numBytes),
+		},
+		Locs: []*hdfs.DatanodeInfoProto{
+			{
+				Id: &hdfs.DatanodeIDProto{
+					IpAddr:   proto.String(ip),
+					HostName: proto.String("fake-datanode"),
+					XferPort: proto.Uint32(uint32(port)),
+				},
+			},
+		},
+	}
+}
+
+// TestBlockWriterRotation exercises writing past a block's capacity: the
+// first BlockWriter should accept only up to blockSize bytes and report
+// ErrEndOfBlock for the rest, and a second BlockWriter (as file_writer.go's
+// startNewBlock would create after an addBlock RPC) should pick up where
+// the first left off.
+func TestBlockWriterRotation(t *testing.T) {
+	const blockSize = 16
+
+	dn1 := newFakeDataNode(t)
+	bw1, err := NewBlockWriter(testBlock(dn1, 0), blockSize)
+	if err != nil {
+		t.Fatalf("NewBlockWriter: %v", err)
+	}
+
+	payload := bytes.Repeat([]byte{'a'}, 24) // one full block plus 8 bytes
+	n, err := bw1.Write(payload)
+	if err != ErrEndOfBlock {
+		t.Fatalf("Write: expected ErrEndOfBlock, got n=%d err=%v", n, err)
+	}
+	if n != blockSize {
+		t.Fatalf("Write: expected to fill the block (%d bytes), got %d", blockSize, n)
+	}
+
+	if err := bw1.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !dn1.lastSeen {
+		t.Fatal("fake datanode never saw a last packet")
+	}
+	if dn1.received.String() != string(payload[:blockSize]) {
+		t.Fatalf("fake datanode received %q, want %q", dn1.received.String(), payload[:blockSize])
+	}
+
+	dn2 := newFakeDataNode(t)
+	bw2, err := NewBlockWriter(testBlock(dn2, 0), blockSize)
+	if err != nil {
+		t.Fatalf("NewBlockWriter (second block): %v", err)
+	}
+
+	rest := payload[blockSize:]
+	n, err = bw2.Write(rest)
+	if err != nil {
+		t.Fatalf("Write (second block): %v", err)
+	}
+	if n != len(rest) {
+		t.Fatalf("Write (second block): wrote %d, want %d", n, len(rest))
+	}
+
+	if err := bw2.Close(); err != nil {
+		t.Fatalf("Close (second block): %v", err)
+	}
+	if dn2.received.String() != string(rest) {
+		t.Fatalf("fake datanode (second block) received %q, want %q", dn2.received.String(), rest)
+	}
+}
+
+// TestResumeBlockWriter checks that appending to a partially-written block
+// continues filling it, rather than starting from byte 0.
+func TestResumeBlockWriter(t *testing.T) {
+	const blockSize = 64
+
+	dn := newFakeDataNode(t)
+	block := testBlock(dn, 10) // block already holds 10 bytes
+
+	bw, err := ResumeBlockWriter(block, blockSize)
+	if err != nil {
+		t.Fatalf("ResumeBlockWriter: %v", err)
+	}
+
+	payload := []byte("hello world")
+	n, err := bw.Write(payload)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if n != len(payload) {
+		t.Fatalf("Write: wrote %d, want %d", n, len(payload))
+	}
+	if want := int64(10 + len(payload)); bw.written != want {
+		t.Fatalf("BlockWriter.written = %d, want %d", bw.written, want)
+	}
+
+	if err := bw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if dn.received.String() != string(payload) {
+		t.Fatalf("fake datanode received %q, want %q", dn.received.String(), payload)
+	}
+}
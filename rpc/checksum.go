@@ -0,0 +1,40 @@
+package rpc
+
+import "fmt"
+
+// ChecksumPolicy controls how BlockReader handles the per-chunk CRC32C
+// checksums that HDFS transmits inline in each Data Transfer Protocol
+// packet.
+type ChecksumPolicy int
+
+const (
+	// ChecksumVerify verifies every chunk's checksum and returns a
+	// ChecksumError on mismatch. This is the default.
+	ChecksumVerify ChecksumPolicy = iota
+
+	// ChecksumSkip skips verification entirely, trading correctness checks
+	// for lower CPU overhead on latency-sensitive callers that trust the
+	// network and disks.
+	ChecksumSkip
+
+	// ChecksumVerifyAndRepair behaves like ChecksumVerify, and additionally
+	// asks the NameNode (via reportBadBlocks) to schedule re-replication of
+	// the corrupt replica once a mismatch has caused a failover to another
+	// replica.
+	ChecksumVerifyAndRepair
+)
+
+// ChecksumError is returned by BlockReader.Read when a chunk's transmitted
+// CRC32C doesn't match the data received for it. Block identifies the block
+// being read, DataNode is the hostname of the replica that served the bad
+// chunk, and Offset is the byte offset within the block at which the
+// mismatched chunk starts.
+type ChecksumError struct {
+	Block    string
+	DataNode string
+	Offset   int64
+}
+
+func (e ChecksumError) Error() string {
+	return fmt.Sprintf("rpc: checksum mismatch in block %s (from %s) at offset %d", e.Block, e.DataNode, e.Offset)
+}
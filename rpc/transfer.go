@@ -0,0 +1,266 @@
+package rpc
+
+import (
+	"bufio"
+	"code.google.com/p/goprotobuf/proto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	hdfs "github.com/colinmarc/hdfs/protocol/hadoop_hdfs"
+	"io"
+	"net"
+)
+
+// clientName identifies this client to DataNodes, matching the name the
+// NameNode RPCs in the hdfs package use.
+const clientName = "go-hdfs"
+
+// Data Transfer Protocol op codes, as defined by
+// org.apache.hadoop.hdfs.protocol.datatransfer.Op.
+const (
+	writeBlockOp byte = 80
+	readBlockOp  byte = 81
+)
+
+// dataTransferVersion is the version of the Data Transfer Protocol
+// implemented here.
+const dataTransferVersion = 28
+
+// writeOp writes the 2-byte version and 1-byte opcode that precede every
+// Data Transfer Protocol request, followed by the length-delimited
+// protobuf request body.
+func writeOp(w io.Writer, op byte, req proto.Message) error {
+	var hdr [3]byte
+	binary.BigEndian.PutUint16(hdr[:2], uint16(dataTransferVersion))
+	hdr[2] = op
+
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+
+	return writeDelimited(w, req)
+}
+
+// writeDelimited writes a protobuf message prefixed with its encoded length
+// as a varint, the framing DataNodes expect for every request, response,
+// and ack on this connection (mirroring Message.writeDelimitedTo).
+func writeDelimited(w io.Writer, msg proto.Message) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+	if _, err := w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// readDelimited reads a single varint-length-prefixed protobuf message, the
+// counterpart to writeDelimited.
+func readDelimited(r *bufio.Reader, msg proto.Message) error {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+
+	return proto.Unmarshal(b, msg)
+}
+
+// writeBlockReadHeader sends an OP_READ_BLOCK request for the byte range
+// [offset, offset+length) of block to the DataNode already connected on
+// conn.
+func writeBlockReadHeader(conn net.Conn, block *hdfs.LocatedBlockProto, offset, length int64) error {
+	req := &hdfs.OpReadBlockProto{
+		Header: &hdfs.ClientOperationHeaderProto{
+			BaseHeader: &hdfs.BaseHeaderProto{
+				Block: block.GetB(),
+				Token: block.GetBlockToken(),
+			},
+			ClientName: proto.String(clientName),
+		},
+		Offset: proto.Uint64(uint64(offset)),
+		Len:    proto.Uint64(uint64(length)),
+	}
+
+	return writeOp(conn, readBlockOp, req)
+}
+
+// writeBlockWriteHeader sends an OP_WRITE_BLOCK request establishing a
+// pipeline that writes block to targets[0], which forwards it on to the
+// rest of targets, and reads back the resulting BlockOpResponseProto.
+func writeBlockWriteHeader(conn net.Conn, in *bufio.Reader, block *hdfs.LocatedBlockProto, targets []*hdfs.DatanodeInfoProto, stage hdfs.OpWriteBlockProto_BlockConstructionStage, bytesRcvd uint64) error {
+	req := &hdfs.OpWriteBlockProto{
+		Header: &hdfs.ClientOperationHeaderProto{
+			BaseHeader: &hdfs.BaseHeaderProto{
+				Block: block.GetB(),
+				Token: block.GetBlockToken(),
+			},
+			ClientName: proto.String(clientName),
+		},
+		Targets:               targets,
+		Stage:                 stage.Enum(),
+		PipelineSize:          proto.Uint32(uint32(len(targets))),
+		MinBytesRcvd:          proto.Uint64(bytesRcvd),
+		MaxBytesRcvd:          proto.Uint64(bytesRcvd),
+		LatestGenerationStamp: proto.Uint64(block.GetB().GetGenerationStamp()),
+		RequestedChecksum: &hdfs.ChecksumProto{
+			Type:             hdfs.ChecksumTypeProto_CHECKSUM_CRC32C.Enum(),
+			BytesPerChecksum: proto.Uint32(chunkSize),
+		},
+	}
+
+	if err := writeOp(conn, writeBlockOp, req); err != nil {
+		return err
+	}
+
+	resp := &hdfs.BlockOpResponseProto{}
+	if err := readDelimited(in, resp); err != nil {
+		return err
+	}
+
+	if resp.GetStatus() != hdfs.Status_SUCCESS {
+		return fmt.Errorf("rpc: datanode rejected write request: %s", resp.GetMessage())
+	}
+
+	return nil
+}
+
+// readBlockOpResponse reads and validates the BlockOpResponseProto that
+// follows an OP_READ_BLOCK request, returning the checksum parameters the
+// DataNode will use for the stream that follows.
+func readBlockOpResponse(r *bufio.Reader) (*hdfs.ReadOpChecksumInfoProto, error) {
+	resp := &hdfs.BlockOpResponseProto{}
+	if err := readDelimited(r, resp); err != nil {
+		return nil, err
+	}
+
+	if resp.GetStatus() != hdfs.Status_SUCCESS {
+		return nil, fmt.Errorf("rpc: datanode rejected read request: %s", resp.GetMessage())
+	}
+
+	return resp.GetReadOpChecksumInfo(), nil
+}
+
+// writePacketHeader writes the per-packet framing fields that precede a
+// packet's checksums and data on the wire: a 4-byte packetLen covering
+// itself, the checksums and the data (but not the PacketHeaderProto, which
+// is framed separately by the 2-byte header length that follows it), and the
+// length-prefixed PacketHeaderProto.
+func writePacketHeader(w *bufio.Writer, seqno, offsetInBlock, dataLen int64, lastPacket bool) error {
+	hdr := &hdfs.PacketHeaderProto{
+		OffsetInBlock:     proto.Int64(offsetInBlock),
+		Seqno:             proto.Int64(seqno),
+		LastPacketInBlock: proto.Bool(lastPacket),
+		DataLen:           proto.Int32(int32(dataLen)),
+	}
+
+	hdrBytes, err := proto.Marshal(hdr)
+	if err != nil {
+		return err
+	}
+
+	checksumLen := numChunks(dataLen, chunkSize) * 4
+	packetLen := int32(checksumLen) + int32(dataLen) + 4
+
+	if err := binary.Write(w, binary.BigEndian, packetLen); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, int16(len(hdrBytes))); err != nil {
+		return err
+	}
+	_, err = w.Write(hdrBytes)
+	return err
+}
+
+// readPacketHeader reads the framing written by writePacketHeader and
+// returns the decoded header along with the checksums and data that follow
+// it on the wire. bytesPerChunk must match the BytesPerChecksum negotiated
+// for this stream (see ReadOpChecksumInfoProto), since that's what
+// determines how many checksums precede the data.
+func readPacketHeader(r *bufio.Reader, bytesPerChunk int64) (*hdfs.PacketHeaderProto, []uint32, []byte, error) {
+	var packetLen int32
+	if err := binary.Read(r, binary.BigEndian, &packetLen); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var hdrLen int16
+	if err := binary.Read(r, binary.BigEndian, &hdrLen); err != nil {
+		return nil, nil, nil, err
+	}
+
+	hdrBytes := make([]byte, hdrLen)
+	if _, err := io.ReadFull(r, hdrBytes); err != nil {
+		return nil, nil, nil, err
+	}
+
+	hdr := &hdfs.PacketHeaderProto{}
+	if err := proto.Unmarshal(hdrBytes, hdr); err != nil {
+		return nil, nil, nil, err
+	}
+
+	dataLen := int64(hdr.GetDataLen())
+	checksums := make([]uint32, numChunks(dataLen, bytesPerChunk))
+	if err := binary.Read(r, binary.BigEndian, checksums); err != nil {
+		return nil, nil, nil, err
+	}
+
+	data := make([]byte, dataLen)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return hdr, checksums, data, nil
+}
+
+// numChunks returns how many bytesPerChunk-byte checksum spans cover
+// dataLen bytes.
+func numChunks(dataLen, bytesPerChunk int64) int64 {
+	if dataLen == 0 {
+		return 0
+	}
+
+	return (dataLen + bytesPerChunk - 1) / bytesPerChunk
+}
+
+// writePacketAck writes a PipelineAckProto in response to a packet, used by
+// the fake DataNode in tests; real DataNodes send this back to the client
+// during writes.
+func writePacketAck(w *bufio.Writer, seqno int64, statuses ...hdfs.Status) error {
+	ack := &hdfs.PipelineAckProto{
+		Seqno:  proto.Int64(seqno),
+		Status: statuses,
+	}
+
+	if err := writeDelimited(w, ack); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// readPacketAck reads a PipelineAckProto off the wire and returns an error
+// if any DataNode in the pipeline reported a non-SUCCESS status.
+func readPacketAck(r *bufio.Reader) error {
+	ack := &hdfs.PipelineAckProto{}
+	if err := readDelimited(r, ack); err != nil {
+		return err
+	}
+
+	for _, status := range ack.GetStatus() {
+		if status != hdfs.Status_SUCCESS {
+			return errors.New("rpc: datanode reported non-success ack status")
+		}
+	}
+
+	return nil
+}